@@ -2,19 +2,45 @@
 package config
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // Config holds all configuration parameters for the reverse proxy server.
-// It includes network settings, timeouts, rate limiting, and backend server list.
+// It includes network settings, timeouts, rate limiting, active health
+// checking, and the backend server list.
 type Config struct {
-	ListenAddr   string
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	RateLimit    int
-	Backends     []string
+	ListenAddr         string
+	ReadTimeout        time.Duration
+	WriteTimeout       time.Duration
+	RateLimit          int
+	Backends           []string
+	HealthPath         string
+	HealthInterval     time.Duration
+	HealthTimeout      time.Duration
+	UnhealthyThreshold int
+	HealthyThreshold   int
+	LBPolicy           string
+	LBHeader           string
+	FlushInterval      time.Duration
+	FCGIRoot           string
+	RateLimitBurst     int
+	RateKey            string
+	MetricsFormat      string
+	MetricsBuckets     []float64
+	CBFailureThreshold int
+	CBTimeout          time.Duration
+
+	// ConfigPath is the `--config` file this Config was loaded from, if
+	// any. The admin reload endpoint and the SIGHUP handler re-read this
+	// path to pick up backend, limit, and threshold changes without a
+	// restart; it is empty when running in flag-only mode.
+	ConfigPath string
 }
 
 // ParseFlags initializes and returns a Config struct with values from command line flags.
@@ -24,16 +50,208 @@ type Config struct {
 //   - write-timeout: Maximum duration for writing response (default 10s)
 //   - rate-limit: Maximum requests per second (default 100)
 //   - backends: Comma-separated list of backend server URLs (default "http://localhost:8080")
+//   - health-path: Path probed on each backend for active health checks (default "/health")
+//   - health-interval: Time between active health probes (default 10s)
+//   - health-timeout: Timeout for a single active health probe (default 2s)
+//   - unhealthy-threshold: Consecutive failed probes before a backend is marked down (default 3)
+//   - healthy-threshold: Consecutive successful probes before a backend is marked up (default 2)
+//   - lb-policy: Load balancing policy - round_robin, weighted_round_robin, least_conn, random, ip_hash, or header_hash (default "round_robin")
+//   - lb-header: Request header hashed by the header_hash policy (default "X-Api-Key")
+//   - flush-interval: How often to flush streamed response bytes to the client; negative flushes immediately after each write (default -1ns, for SSE/gRPC-style responses)
+//   - fcgi-root: DOCUMENT_ROOT passed to fcgi:// backends (default "")
+//   - rate-burst: Token bucket burst size; non-positive falls back to rate-limit (default 0)
+//   - rate-key: Rate limit bucket key - ip, path, or header:<Name> (default "ip")
+//   - metrics-format: Format served on /metrics - json, prometheus, or both (default "prometheus")
+//   - metrics-buckets: Comma-separated proxy_request_duration_seconds histogram bucket upper bounds, in seconds (default metrics.DefaultBuckets)
+//   - cb-failure-threshold: Consecutive backend failures before the circuit breaker opens (default 5)
+//   - cb-timeout: How long the circuit breaker stays open before probing the backend again (default 10s)
+//   - config: Path to a JSON config file to load instead of the flags above (default "", flag mode)
+//
+// When --config is set, every flag above is ignored in favor of the
+// file's contents; the file is re-read on SIGHUP and on POST
+// /admin/reload so backends, limits, and thresholds can change without
+// a restart.
 func ParseFlags() *Config {
 	cfg := &Config{}
 
+	configPath := flag.String("config", "", "Path to a JSON config file; when set, all other flags are ignored")
 	flag.StringVar(&cfg.ListenAddr, "listen", ":3000", "Listen address")
 	flag.DurationVar(&cfg.ReadTimeout, "read-timeout", 5*time.Second, "Read timeout")
 	flag.DurationVar(&cfg.WriteTimeout, "write-timeout", 10*time.Second, "Write timeout")
 	flag.IntVar(&cfg.RateLimit, "rate-limit", 100, "Requests per second limit")
 	backends := flag.String("backends", "http://localhost:8080", "Comma-separated backend servers")
+	flag.StringVar(&cfg.HealthPath, "health-path", "/health", "Path probed on each backend for active health checks")
+	flag.DurationVar(&cfg.HealthInterval, "health-interval", 10*time.Second, "Time between active health probes")
+	flag.DurationVar(&cfg.HealthTimeout, "health-timeout", 2*time.Second, "Timeout for a single active health probe")
+	flag.IntVar(&cfg.UnhealthyThreshold, "unhealthy-threshold", 3, "Consecutive failed probes before a backend is marked down")
+	flag.IntVar(&cfg.HealthyThreshold, "healthy-threshold", 2, "Consecutive successful probes before a backend is marked up")
+	flag.StringVar(&cfg.LBPolicy, "lb-policy", "round_robin", "Load balancing policy: round_robin, weighted_round_robin, least_conn, random, ip_hash, or header_hash")
+	flag.StringVar(&cfg.LBHeader, "lb-header", "X-Api-Key", "Request header hashed by the header_hash load balancing policy")
+	flag.DurationVar(&cfg.FlushInterval, "flush-interval", -1, "How often to flush streamed response bytes to the client; negative flushes immediately after each write")
+	flag.StringVar(&cfg.FCGIRoot, "fcgi-root", "", "DOCUMENT_ROOT passed to fcgi:// backends")
+	flag.IntVar(&cfg.RateLimitBurst, "rate-burst", 0, "Token bucket burst size; non-positive falls back to rate-limit")
+	flag.StringVar(&cfg.RateKey, "rate-key", "ip", "Rate limit bucket key: ip, path, or header:<Name>")
+	flag.StringVar(&cfg.MetricsFormat, "metrics-format", "prometheus", "Format served on /metrics: json, prometheus, or both")
+	buckets := flag.String("metrics-buckets", "", "Comma-separated proxy_request_duration_seconds histogram bucket upper bounds, in seconds")
+	flag.IntVar(&cfg.CBFailureThreshold, "cb-failure-threshold", 5, "Consecutive backend failures before the circuit breaker opens")
+	flag.DurationVar(&cfg.CBTimeout, "cb-timeout", 10*time.Second, "How long the circuit breaker stays open before probing the backend again")
 
 	flag.Parse()
+
+	if *configPath != "" {
+		fileCfg, err := LoadFile(*configPath)
+		if err != nil {
+			panic(fmt.Sprintf("config: loading %s: %v", *configPath, err))
+		}
+		return fileCfg
+	}
+
 	cfg.Backends = strings.Split(*backends, ",")
+	cfg.MetricsBuckets = parseBuckets(*buckets)
 	return cfg
 }
+
+// FileConfig is the on-disk JSON representation loaded by --config and
+// re-read on every reload. Durations are strings parsed with
+// time.ParseDuration (e.g. "10s"), matching the flags they replace;
+// fields left zero-valued fall back to the same defaults ParseFlags
+// uses.
+type FileConfig struct {
+	ListenAddr         string    `json:"listen"`
+	ReadTimeout        string    `json:"read_timeout"`
+	WriteTimeout       string    `json:"write_timeout"`
+	RateLimit          int       `json:"rate_limit"`
+	RateLimitBurst     int       `json:"rate_burst"`
+	RateKey            string    `json:"rate_key"`
+	Backends           []string  `json:"backends"`
+	HealthPath         string    `json:"health_path"`
+	HealthInterval     string    `json:"health_interval"`
+	HealthTimeout      string    `json:"health_timeout"`
+	UnhealthyThreshold int       `json:"unhealthy_threshold"`
+	HealthyThreshold   int       `json:"healthy_threshold"`
+	LBPolicy           string    `json:"lb_policy"`
+	LBHeader           string    `json:"lb_header"`
+	FlushInterval      string    `json:"flush_interval"`
+	FCGIRoot           string    `json:"fcgi_root"`
+	MetricsFormat      string    `json:"metrics_format"`
+	MetricsBuckets     []float64 `json:"metrics_buckets"`
+	CBFailureThreshold int       `json:"cb_failure_threshold"`
+	CBTimeout          string    `json:"cb_timeout"`
+}
+
+// LoadFile reads and parses the JSON config file at path into a Config,
+// applying the same defaults ParseFlags uses for any field the file
+// leaves at its zero value. It is called once by ParseFlags for
+// --config, and again on every SIGHUP and POST /admin/reload to pick up
+// edits to the file.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fc FileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("config: parsing %s: %w", path, err)
+	}
+
+	cfg := &Config{
+		ListenAddr:         fc.ListenAddr,
+		RateLimit:          fc.RateLimit,
+		RateLimitBurst:     fc.RateLimitBurst,
+		RateKey:            fc.RateKey,
+		Backends:           fc.Backends,
+		HealthPath:         fc.HealthPath,
+		UnhealthyThreshold: fc.UnhealthyThreshold,
+		HealthyThreshold:   fc.HealthyThreshold,
+		LBPolicy:           fc.LBPolicy,
+		LBHeader:           fc.LBHeader,
+		FCGIRoot:           fc.FCGIRoot,
+		MetricsFormat:      fc.MetricsFormat,
+		MetricsBuckets:     fc.MetricsBuckets,
+		CBFailureThreshold: fc.CBFailureThreshold,
+		ConfigPath:         path,
+	}
+
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = ":3000"
+	}
+	if len(cfg.Backends) == 0 {
+		cfg.Backends = []string{"http://localhost:8080"}
+	}
+	if cfg.HealthPath == "" {
+		cfg.HealthPath = "/health"
+	}
+	if cfg.UnhealthyThreshold == 0 {
+		cfg.UnhealthyThreshold = 3
+	}
+	if cfg.HealthyThreshold == 0 {
+		cfg.HealthyThreshold = 2
+	}
+	if cfg.LBPolicy == "" {
+		cfg.LBPolicy = "round_robin"
+	}
+	if cfg.LBHeader == "" {
+		cfg.LBHeader = "X-Api-Key"
+	}
+	if cfg.RateKey == "" {
+		cfg.RateKey = "ip"
+	}
+	if cfg.MetricsFormat == "" {
+		cfg.MetricsFormat = "prometheus"
+	}
+	if cfg.RateLimit == 0 {
+		cfg.RateLimit = 100
+	}
+
+	var durationErr error
+	cfg.ReadTimeout = parseDurationOr(fc.ReadTimeout, 5*time.Second, &durationErr)
+	cfg.WriteTimeout = parseDurationOr(fc.WriteTimeout, 10*time.Second, &durationErr)
+	cfg.HealthInterval = parseDurationOr(fc.HealthInterval, 10*time.Second, &durationErr)
+	cfg.HealthTimeout = parseDurationOr(fc.HealthTimeout, 2*time.Second, &durationErr)
+	cfg.FlushInterval = parseDurationOr(fc.FlushInterval, -1, &durationErr)
+	cfg.CBTimeout = parseDurationOr(fc.CBTimeout, 10*time.Second, &durationErr)
+	if durationErr != nil {
+		return nil, fmt.Errorf("config: parsing %s: %w", path, durationErr)
+	}
+
+	return cfg, nil
+}
+
+// parseDurationOr parses spec if non-empty, returning def otherwise. The
+// first parse failure is recorded into *errOut so LoadFile can report it
+// after checking every duration field, rather than stopping at the
+// first one.
+func parseDurationOr(spec string, def time.Duration, errOut *error) time.Duration {
+	if spec == "" {
+		return def
+	}
+	d, err := time.ParseDuration(spec)
+	if err != nil {
+		if *errOut == nil {
+			*errOut = err
+		}
+		return def
+	}
+	return d
+}
+
+// parseBuckets parses a comma-separated list of histogram bucket upper
+// bounds. An empty spec returns nil so callers can fall back to their
+// own default buckets.
+func parseBuckets(spec string) []float64 {
+	if spec == "" {
+		return nil
+	}
+
+	parts := strings.Split(spec, ",")
+	buckets := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			continue
+		}
+		buckets = append(buckets, v)
+	}
+	return buckets
+}
@@ -0,0 +1,210 @@
+// Package health implements active health checking for backend servers.
+// It complements the reactive circuit breaker by periodically probing
+// each backend so that failures and recoveries are detected without
+// waiting for live traffic.
+package health
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"reverse_proxy/internal/middleware"
+	"reverse_proxy/internal/transport/fastcgi"
+)
+
+// fcgiScheme is the `--backends` prefix identifying a FastCGI backend,
+// matching the one proxy.ProxyHandler checks to route requests through
+// the FastCGI transport instead of plain HTTP.
+const fcgiScheme = "fcgi://"
+
+// Config holds the tunables for the active health check probes.
+type Config struct {
+	Path               string
+	Interval           time.Duration
+	Timeout            time.Duration
+	ExpectedStatus     int
+	UnhealthyThreshold int
+	HealthyThreshold   int
+}
+
+// backendState tracks the consecutive probe outcomes for a single backend.
+type backendState struct {
+	healthy              bool
+	consecutiveFailures  int
+	consecutiveSuccesses int
+}
+
+// Checker runs periodic active health probes against a fixed set of
+// backends and exposes their current healthiness.
+type Checker struct {
+	mu       sync.RWMutex
+	cfg      Config
+	backends map[string]*backendState
+	client   *http.Client
+	cb       *middleware.CircuitBreaker
+	stopCh   chan struct{}
+}
+
+// New creates a new Checker for the given backends. All backends start
+// out marked healthy so a freshly started proxy routes traffic
+// immediately, with the first few probes able to mark a backend down.
+//
+// Parameters:
+//   - backends: Backend server URLs to probe
+//   - cfg: Probe path, interval, timeout, and up/down thresholds
+//   - cb: Circuit breaker to synchronize with probe results
+//
+// Returns:
+//   - *Checker: A new, unstarted health checker
+func New(backends []string, cfg Config, cb *middleware.CircuitBreaker) *Checker {
+	states := make(map[string]*backendState, len(backends))
+	for _, backend := range backends {
+		states[backend] = &backendState{healthy: true}
+	}
+
+	return &Checker{
+		cfg:      cfg,
+		backends: states,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		cb:       cb,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start launches one probing goroutine per backend, each driven by its
+// own time.Ticker at the configured interval.
+func (c *Checker) Start() {
+	for backend := range c.backends {
+		go c.run(backend)
+	}
+}
+
+// Stop terminates all probing goroutines.
+func (c *Checker) Stop() {
+	close(c.stopCh)
+}
+
+// run drives periodic probes for a single backend until Stop is called.
+func (c *Checker) run(backend string) {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+			c.probe(backend)
+		}
+	}
+}
+
+// probe checks a single backend's reachability, recording whether it
+// responded as expected. FastCGI backends don't speak HTTP, so they are
+// probed with a raw dial instead of the HTTP GET used for everything
+// else.
+func (c *Checker) probe(backend string) {
+	if strings.HasPrefix(backend, fcgiScheme) {
+		c.probeFastCGI(backend)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodGet, backend+c.cfg.Path, nil)
+	if err != nil {
+		c.record(backend, false)
+		return
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.record(backend, false)
+		return
+	}
+	defer resp.Body.Close()
+
+	c.record(backend, resp.StatusCode == c.cfg.ExpectedStatus)
+}
+
+// probeFastCGI checks an fcgi:// backend by dialing its application
+// server directly - a plain TCP/unix connect - since FastCGI has no
+// HTTP health path to GET.
+func (c *Checker) probeFastCGI(backend string) {
+	network, address, err := fastcgi.ParseAddress(&url.URL{
+		Scheme: "fcgi",
+		Opaque: strings.TrimPrefix(backend, fcgiScheme),
+	})
+	if err != nil {
+		c.record(backend, false)
+		return
+	}
+
+	conn, err := net.DialTimeout(network, address, c.cfg.Timeout)
+	if err != nil {
+		c.record(backend, false)
+		return
+	}
+	conn.Close()
+
+	c.record(backend, true)
+}
+
+// record updates the consecutive success/failure counters for a backend
+// and flips its healthiness once the configured threshold is crossed,
+// synchronizing the result with the circuit breaker.
+func (c *Checker) record(backend string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, exists := c.backends[backend]
+	if !exists {
+		return
+	}
+
+	if ok {
+		state.consecutiveSuccesses++
+		state.consecutiveFailures = 0
+		if !state.healthy && state.consecutiveSuccesses >= c.cfg.HealthyThreshold {
+			state.healthy = true
+			c.cb.Reset(backend)
+		}
+		return
+	}
+
+	state.consecutiveFailures++
+	state.consecutiveSuccesses = 0
+	if state.healthy && state.consecutiveFailures >= c.cfg.UnhealthyThreshold {
+		state.healthy = false
+		c.cb.ForceOpen(backend)
+	}
+}
+
+// IsHealthy reports whether a backend's active health checks currently
+// consider it up. Unknown backends are treated as healthy so callers
+// that add backends without registering them fail open.
+func (c *Checker) IsHealthy(backend string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	state, exists := c.backends[backend]
+	if !exists {
+		return true
+	}
+	return state.healthy
+}
+
+// Snapshot returns a point-in-time copy of every backend's healthiness,
+// suitable for serializing on the /health endpoint.
+func (c *Checker) Snapshot() map[string]bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	out := make(map[string]bool, len(c.backends))
+	for backend, state := range c.backends {
+		out[backend] = state.healthy
+	}
+	return out
+}
@@ -1,54 +1,120 @@
-// Loadbalancer implements a round-robin load balancing algorithm
-// for distributing requests across multiple backend servers.
+// Loadbalancer distributes requests across multiple backend servers
+// using a pluggable selection Policy (round robin, weighted round
+// robin, least connections, random, or hashing on the client IP or a
+// request header).
 package loadbalancer
 
 import (
-	"reverse_proxy/internal/middleware"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync/atomic"
+
+	"reverse_proxy/internal/health"
+	"reverse_proxy/internal/middleware"
 )
 
+// Backend represents a single upstream server under load balancing.
+// InFlight tracks the number of requests currently proxied to this
+// backend and is read and updated with atomic operations so the least
+// connections policy can compare load across backends without a lock.
+type Backend struct {
+	URL      string
+	Weight   int
+	InFlight int64
+}
+
+// IncInFlight increments the backend's in-flight request counter.
+func (b *Backend) IncInFlight() { atomic.AddInt64(&b.InFlight, 1) }
+
+// DecInFlight decrements the backend's in-flight request counter.
+func (b *Backend) DecInFlight() { atomic.AddInt64(&b.InFlight, -1) }
+
+// LoadInFlight atomically reads the backend's current in-flight request count.
+func (b *Backend) LoadInFlight() int64 { return atomic.LoadInt64(&b.InFlight) }
+
+// ParseBackendSpec splits a `--backends` entry into its URL and weight.
+// Entries may be a bare URL (weight defaults to 1) or `url|weight` as
+// used by the weighted_round_robin policy. A missing or invalid weight
+// falls back to 1 rather than rejecting the backend outright.
+func ParseBackendSpec(spec string) (url string, weight int) {
+	parts := strings.SplitN(spec, "|", 2)
+	if len(parts) == 1 {
+		return parts[0], 1
+	}
+
+	weight, err := strconv.Atoi(parts[1])
+	if err != nil || weight <= 0 {
+		weight = 1
+	}
+	return parts[0], weight
+}
+
 // LoadBalancer is a struct that manages the distribution of requests across multiple backend servers
 type LoadBalancer struct {
-	backends []string
-	current  uint64
+	backends []*Backend
 	cb       *middleware.CircuitBreaker
+	health   *health.Checker
+	policy   Policy
 }
 
-// New creates a new LoadBalancer instance with the provided backend server URLs and a circuit breaker.
-// It initializes the round-robin counter to 0.
+// New creates a new LoadBalancer instance with the provided backend server specs, a circuit breaker,
+// an active health checker, and a selection policy.
 //
 // Parameters:
-//   - backends: A slice of backend server URLs to distribute requests across
+//   - backendSpecs: Backend server URLs to distribute requests across, optionally suffixed with `|weight`
 //   - cb: A circuit breaker instance to check the availability of backends
+//   - hc: An active health checker to check the probed status of backends
+//   - policy: The selection policy used to pick a backend from the healthy candidates
 //
 // Returns:
 //   - *LoadBalancer: A new load balancer instance
-func New(backends []string, cb *middleware.CircuitBreaker) *LoadBalancer {
+func New(backendSpecs []string, cb *middleware.CircuitBreaker, hc *health.Checker, policy Policy) *LoadBalancer {
+	backends := make([]*Backend, 0, len(backendSpecs))
+	for _, spec := range backendSpecs {
+		url, weight := ParseBackendSpec(spec)
+		backends = append(backends, &Backend{URL: url, Weight: weight})
+	}
+
 	return &LoadBalancer{
 		backends: backends,
-		current:  0,
 		cb:       cb,
+		health:   hc,
+		policy:   policy,
 	}
 }
 
-// Next returns the URL of the next backend server in round-robin order.
-// It uses atomic operations to safely increment the counter across multiple goroutines.
-// It also checks the circuit breaker to ensure the backend is available.
+// Next returns the backend selected by the configured policy for the given request.
+// It first narrows the candidate set to backends the active health checker
+// considers up and whose circuit breaker is not open, then delegates the
+// final choice to the policy.
 //
 // Returns:
-//   - string: The URL of the next backend server, or empty string if no backends are available
-func (lb *LoadBalancer) Next() string {
+//   - *Backend: The selected backend, or nil if no backends are available
+func (lb *LoadBalancer) Next(r *http.Request) *Backend {
 	if len(lb.backends) == 0 {
-		return ""
+		return nil
 	}
 
-	start := atomic.AddUint64(&lb.current, 1)
-	for i := 0; i < len(lb.backends); i++ {
-		idx := (start + uint64(i)) % uint64(len(lb.backends))
-		backend := lb.backends[idx]
-		if !lb.cb.IsBackendOpen(backend) {
-			return backend
+	available := make([]*Backend, 0, len(lb.backends))
+	for _, backend := range lb.backends {
+		if !lb.health.IsHealthy(backend.URL) {
+			continue
 		}
+		if lb.cb.IsBackendOpen(backend.URL) {
+			continue
+		}
+		available = append(available, backend)
+	}
+
+	if len(available) == 0 {
+		return nil
 	}
-	return ""
+	return lb.policy.Select(available, r)
+}
+
+// Backends returns every backend configured on this load balancer,
+// regardless of current health or circuit state.
+func (lb *LoadBalancer) Backends() []*Backend {
+	return lb.backends
 }
@@ -0,0 +1,127 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+)
+
+// Policy selects one backend from a set of already-healthy candidates
+// for a given request.
+type Policy interface {
+	Select(backends []*Backend, r *http.Request) *Backend
+}
+
+// NewPolicy constructs the Policy named by the `--lb-policy` flag.
+// header is the request header consulted by the header_hash policy and
+// is ignored by every other policy.
+//
+// Returns:
+//   - Policy: The constructed selection policy
+//   - error: If name does not match a known policy
+func NewPolicy(name, header string) (Policy, error) {
+	switch name {
+	case "", "round_robin":
+		return &roundRobinPolicy{}, nil
+	case "weighted_round_robin":
+		return &weightedRoundRobinPolicy{}, nil
+	case "least_conn":
+		return &leastConnPolicy{}, nil
+	case "random":
+		return &randomPolicy{}, nil
+	case "ip_hash":
+		return &ipHashPolicy{}, nil
+	case "header_hash":
+		return &headerHashPolicy{header: header}, nil
+	default:
+		return nil, fmt.Errorf("loadbalancer: unknown policy %q", name)
+	}
+}
+
+// roundRobinPolicy cycles through candidates in order.
+type roundRobinPolicy struct {
+	counter uint64
+}
+
+func (p *roundRobinPolicy) Select(backends []*Backend, r *http.Request) *Backend {
+	idx := atomic.AddUint64(&p.counter, 1)
+	return backends[idx%uint64(len(backends))]
+}
+
+// weightedRoundRobinPolicy cycles through candidates proportionally to
+// their configured weight.
+type weightedRoundRobinPolicy struct {
+	counter uint64
+}
+
+func (p *weightedRoundRobinPolicy) Select(backends []*Backend, r *http.Request) *Backend {
+	totalWeight := 0
+	for _, backend := range backends {
+		totalWeight += backend.Weight
+	}
+	if totalWeight <= 0 {
+		return backends[0]
+	}
+
+	target := int(atomic.AddUint64(&p.counter, 1) % uint64(totalWeight))
+	for _, backend := range backends {
+		if target < backend.Weight {
+			return backend
+		}
+		target -= backend.Weight
+	}
+	return backends[len(backends)-1]
+}
+
+// leastConnPolicy picks the candidate with the fewest in-flight requests.
+type leastConnPolicy struct{}
+
+func (p *leastConnPolicy) Select(backends []*Backend, r *http.Request) *Backend {
+	// Start from a random candidate rather than always backends[0], so
+	// that ties (the common case when in-flight counts are frequently 0,
+	// e.g. under low concurrency) are broken differently each call
+	// instead of always favoring the same backend.
+	start := rand.Intn(len(backends))
+	best := backends[start]
+	for i := 1; i < len(backends); i++ {
+		backend := backends[(start+i)%len(backends)]
+		if backend.LoadInFlight() < best.LoadInFlight() {
+			best = backend
+		}
+	}
+	return best
+}
+
+// randomPolicy picks a uniformly random candidate.
+type randomPolicy struct{}
+
+func (p *randomPolicy) Select(backends []*Backend, r *http.Request) *Backend {
+	return backends[rand.Intn(len(backends))]
+}
+
+// ipHashPolicy hashes the client's remote address to provide sticky
+// routing for a given client across requests.
+type ipHashPolicy struct{}
+
+func (p *ipHashPolicy) Select(backends []*Backend, r *http.Request) *Backend {
+	return backends[hashKey(r.RemoteAddr, len(backends))]
+}
+
+// headerHashPolicy hashes a configured request header to provide sticky
+// routing for requests sharing that header value.
+type headerHashPolicy struct {
+	header string
+}
+
+func (p *headerHashPolicy) Select(backends []*Backend, r *http.Request) *Backend {
+	return backends[hashKey(r.Header.Get(p.header), len(backends))]
+}
+
+// hashKey deterministically maps a string key onto an index in [0, n).
+func hashKey(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
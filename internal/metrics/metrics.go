@@ -1,25 +1,115 @@
-// Metrics provides request tracking and monitoring capabilities for the proxy server.
+// Metrics provides request tracking and monitoring capabilities for the proxy server,
+// exposed as both a simple JSON summary and Prometheus text exposition format.
 package metrics
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
-// Metrics struct tracks the counts of requests, responses and errors processed by the proxy.
+// DefaultBuckets are the request duration histogram bucket upper bounds,
+// in seconds, used when none are configured.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// backendSource supplies the live, per-backend gauge values (in-flight
+// requests, active health, and circuit breaker state) that the
+// Prometheus handler renders. The metrics package depends on this
+// narrow interface rather than the loadbalancer/health/middleware
+// packages directly, so it stays free to track request counts and
+// durations without needing to know how those components are wired up.
+type backendSource interface {
+	Backends() []string
+	InFlight(backend string) int64
+	IsHealthy(backend string) bool
+	CircuitState(backend string) int
+}
+
+// requestKey identifies one {method, backend, status} label combination
+// for the requests-total counter.
+type requestKey struct {
+	method, backend string
+	status          int
+}
+
+// durationKey identifies one {method, backend} label combination for
+// the request duration histogram.
+type durationKey struct {
+	method, backend string
+}
+
+// histogram is a cumulative-bucket latency histogram, matching the
+// Prometheus histogram wire format: each bucket counts every
+// observation less than or equal to its upper bound.
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &histogram{buckets: b, counts: make([]uint64, len(b))}
+}
+
+func (h *histogram) observe(seconds float64) {
+	h.sum += seconds
+	h.count++
+	for i, upperBound := range h.buckets {
+		if seconds <= upperBound {
+			h.counts[i]++
+		}
+	}
+}
+
+// Metrics struct tracks the counts of requests, responses and errors processed by the proxy,
+// along with RED-style (rate, errors, duration) signals labeled by method, backend, and status.
 type Metrics struct {
-	RequestCount  uint64
-	ResponseCount uint64
-	ErrorCount    uint64
+	RequestCount          uint64
+	ResponseCount         uint64
+	ErrorCount            uint64
+	ClientDisconnectCount uint64
+
+	buckets []float64
+
+	mu            sync.Mutex
+	requestsTotal map[requestKey]uint64
+	durations     map[durationKey]*histogram
+
+	backends backendSource
 }
 
 // New creates and returns a new Metrics instance with all counters initialized to zero.
+// Parameters:
+//   - buckets: Histogram bucket upper bounds, in seconds, for proxy_request_duration_seconds; empty falls back to DefaultBuckets
 //
 // Returns:
 //   - *Metrics: A new metrics tracker instance
-func New() *Metrics {
-	return &Metrics{}
+func New(buckets []float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	return &Metrics{
+		buckets:       buckets,
+		requestsTotal: make(map[requestKey]uint64),
+		durations:     make(map[durationKey]*histogram),
+	}
+}
+
+// RegisterBackends connects the metrics tracker to the live load
+// balancer, health checker, and circuit breaker so the Prometheus
+// handler can render proxy_inflight_requests, proxy_backend_up, and
+// proxy_circuit_state without duplicating that state itself.
+func (m *Metrics) RegisterBackends(backends backendSource) {
+	m.backends = backends
 }
 
 // IncRequest atomically increments the request counter by one.
@@ -31,6 +121,29 @@ func (m *Metrics) IncResponse() { atomic.AddUint64(&m.ResponseCount, 1) }
 // IncError atomically increments the error counter by one.
 func (m *Metrics) IncError() { atomic.AddUint64(&m.ErrorCount, 1) }
 
+// IncClientDisconnect atomically increments the client disconnect counter by one.
+// Client disconnects (the request context canceled before the backend responded)
+// are tracked separately from backend errors since they aren't the backend's fault.
+func (m *Metrics) IncClientDisconnect() { atomic.AddUint64(&m.ClientDisconnectCount, 1) }
+
+// ObserveRequest records one completed proxy request against the
+// requests-total counter and the request duration histogram, labeled
+// by method, backend, and (for the counter) response status.
+func (m *Metrics) ObserveRequest(method, backend string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requestsTotal[requestKey{method: method, backend: backend, status: status}]++
+
+	dk := durationKey{method: method, backend: backend}
+	h, exists := m.durations[dk]
+	if !exists {
+		h = newHistogram(m.buckets)
+		m.durations[dk] = h
+	}
+	h.observe(duration.Seconds())
+}
+
 // Handler returns an HTTP handler that exposes the current metrics as JSON.
 // The metrics endpoint returns counts for total requests, responses and errors.
 //
@@ -39,10 +152,104 @@ func (m *Metrics) IncError() { atomic.AddUint64(&m.ErrorCount, 1) }
 func (m *Metrics) Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		stats := map[string]uint64{
-			"requests":  m.RequestCount,
-			"responses": m.ResponseCount,
-			"errors":    m.ErrorCount,
+			"requests":           atomic.LoadUint64(&m.RequestCount),
+			"responses":          atomic.LoadUint64(&m.ResponseCount),
+			"errors":             atomic.LoadUint64(&m.ErrorCount),
+			"client_disconnects": atomic.LoadUint64(&m.ClientDisconnectCount),
 		}
+		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(stats)
 	})
 }
+
+// PrometheusHandler returns an HTTP handler that exposes the current
+// metrics in Prometheus text exposition format, including the RED
+// signals and the live per-backend gauges from RegisterBackends.
+//
+// Returns:
+//   - http.Handler: Handler that serves the metrics data
+func (m *Metrics) PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.writePrometheus(w)
+	})
+}
+
+// FormatHandler dispatches to the Prometheus or JSON handler based on
+// format ("json", "prometheus", or "both"). For "both", the JSON
+// representation is served to clients that ask for
+// Accept: application/json; everyone else gets Prometheus text.
+func (m *Metrics) FormatHandler(format string) http.Handler {
+	switch format {
+	case "json":
+		return m.Handler()
+	case "both":
+		prom := m.PrometheusHandler()
+		json := m.Handler()
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.Header.Get("Accept"), "application/json") {
+				json.ServeHTTP(w, r)
+				return
+			}
+			prom.ServeHTTP(w, r)
+		})
+	default:
+		return m.PrometheusHandler()
+	}
+}
+
+func (m *Metrics) writePrometheus(w http.ResponseWriter) {
+	fmt.Fprintf(w, "# TYPE proxy_requests_total counter\n")
+
+	m.mu.Lock()
+	for key, count := range m.requestsTotal {
+		fmt.Fprintf(w, "proxy_requests_total{method=%q,backend=%q,status=%q} %d\n",
+			key.method, key.backend, fmt.Sprint(key.status), count)
+	}
+
+	fmt.Fprintf(w, "# TYPE proxy_request_duration_seconds histogram\n")
+	for key, h := range m.durations {
+		for i, upperBound := range h.buckets {
+			fmt.Fprintf(w, "proxy_request_duration_seconds_bucket{method=%q,backend=%q,le=%q} %d\n",
+				key.method, key.backend, formatFloat(upperBound), h.counts[i])
+		}
+		fmt.Fprintf(w, "proxy_request_duration_seconds_bucket{method=%q,backend=%q,le=\"+Inf\"} %d\n",
+			key.method, key.backend, h.count)
+		fmt.Fprintf(w, "proxy_request_duration_seconds_sum{method=%q,backend=%q} %s\n",
+			key.method, key.backend, formatFloat(h.sum))
+		fmt.Fprintf(w, "proxy_request_duration_seconds_count{method=%q,backend=%q} %d\n",
+			key.method, key.backend, h.count)
+	}
+	m.mu.Unlock()
+
+	if m.backends == nil {
+		return
+	}
+
+	fmt.Fprintf(w, "# TYPE proxy_inflight_requests gauge\n")
+	for _, backend := range m.backends.Backends() {
+		fmt.Fprintf(w, "proxy_inflight_requests{backend=%q} %d\n", backend, m.backends.InFlight(backend))
+	}
+
+	fmt.Fprintf(w, "# TYPE proxy_backend_up gauge\n")
+	for _, backend := range m.backends.Backends() {
+		up := 0
+		if m.backends.IsHealthy(backend) {
+			up = 1
+		}
+		fmt.Fprintf(w, "proxy_backend_up{backend=%q} %d\n", backend, up)
+	}
+
+	fmt.Fprintf(w, "# TYPE proxy_circuit_state gauge\n")
+	for _, backend := range m.backends.Backends() {
+		fmt.Fprintf(w, "proxy_circuit_state{backend=%q} %d\n", backend, m.backends.CircuitState(backend))
+	}
+}
+
+func formatFloat(f float64) string {
+	s := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", f), "0"), ".")
+	if s == "" {
+		return "0"
+	}
+	return s
+}
@@ -2,9 +2,6 @@
 package middleware
 
 import (
-	"log"
-	"net/http"
-	"reverse_proxy/internal/errors"
 	"sync"
 	"time"
 )
@@ -33,12 +30,31 @@ type backendState struct {
 	lastFailureTime time.Time
 }
 
-// NewCircuitBreaker creates a new circuit breaker with default settings
-func NewCircuitBreaker() *CircuitBreaker {
+// defaultFailureThreshold and defaultTimeout are the circuit breaker
+// settings used when NewCircuitBreaker is called with a non-positive
+// threshold or timeout, matching the values it always used before they
+// became configurable.
+const (
+	defaultFailureThreshold = 5
+	defaultTimeout          = 10 * time.Second
+)
+
+// NewCircuitBreaker creates a new circuit breaker. A backend's circuit
+// opens after failureThreshold consecutive failures and moves to
+// half-open after timeout has elapsed; non-positive values fall back to
+// the package defaults.
+func NewCircuitBreaker(failureThreshold int, timeout time.Duration) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = defaultFailureThreshold
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
 	return &CircuitBreaker{
 		backends:         make(map[string]*backendState),
-		failureThreshold: 5,
-		timeout:          10 * time.Second,
+		failureThreshold: failureThreshold,
+		timeout:          timeout,
 	}
 }
 
@@ -79,6 +95,56 @@ func (cb *CircuitBreaker) OnBackendSuccess(backend string) {
 	}
 }
 
+// Reset clears a backend's failure count and forces its circuit closed.
+// It is used by external health checks to bring a backend back into
+// rotation as soon as an active probe confirms it has recovered, rather
+// than waiting for the passive half-open timeout to elapse.
+func (cb *CircuitBreaker) Reset(backend string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	state, exists := cb.backends[backend]
+	if !exists {
+		state = &backendState{}
+		cb.backends[backend] = state
+	}
+
+	state.state = StateClosed
+	state.failureCount = 0
+}
+
+// ForceOpen immediately trips a backend's circuit, independent of the
+// request-driven failure counter. It is used by external health checks
+// so a backend confirmed down by an active probe stops receiving
+// traffic without waiting for a live request to fail against it.
+func (cb *CircuitBreaker) ForceOpen(backend string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	state, exists := cb.backends[backend]
+	if !exists {
+		state = &backendState{}
+		cb.backends[backend] = state
+	}
+
+	state.state = StateOpen
+	state.lastFailureTime = time.Now()
+}
+
+// State reports a backend's current circuit state without mutating it,
+// for read-only consumers like the Prometheus metrics handler. Unknown
+// backends report StateClosed.
+func (cb *CircuitBreaker) State(backend string) CircuitState {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+
+	state, exists := cb.backends[backend]
+	if !exists {
+		return StateClosed
+	}
+	return state.state
+}
+
 // IsBackendOpen checks if the circuit is currently open (failing).
 // If the timeout period has elapsed, transitions to half-open state.
 // Returns:
@@ -110,32 +176,3 @@ func (cb *CircuitBreaker) IsBackendOpen(backend string) bool {
 	}
 	return false
 }
-
-// Middleware wraps an http.Handler with circuit breaker functionality.
-// Blocks requests when the circuit is open, allows a single request through
-// when half-open, and tracks success/failure of requests to manage circuit state.
-// Parameters:
-//   - next: The handler to wrap with circuit breaking
-//
-// Returns:
-//   - http.Handler: A new handler that implements circuit breaking
-func (cb *CircuitBreaker) Middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		backend := r.URL.Host
-		if cb.IsBackendOpen(backend) {
-			errors.HandleError(w, errors.HTTPError{
-				Status:  http.StatusServiceUnavailable,
-				Message: "Circuit breaker is open",
-			}, log.Default())
-			return
-		}
-		wrapped := &ResponseWriter{ResponseWriter: w}
-		next.ServeHTTP(wrapped, r)
-
-		if wrapped.StatusCode >= 500 {
-			cb.OnBackendFailure(backend)
-		} else {
-			cb.OnBackendSuccess(backend)
-		}
-	})
-}
@@ -2,65 +2,200 @@
 package middleware
 
 import (
+	"fmt"
+	"hash/fnv"
 	"log"
+	"math"
+	"net"
 	"net/http"
-	"reverse_proxy/internal/errors"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"reverse_proxy/internal/errors"
 )
 
-// // RateLimiter implements a sliding window rate limiting algorithm.
-// It tracks request timestamps within a sliding window to enforce
-// requests per second (RPS) limits.
+// shardCount controls how many independent locks protect the bucket
+// map, trading memory for reduced contention under concurrent requests
+// from many different clients.
+const shardCount = 32
+
+// KeyFunc extracts the identity a rate limit bucket is keyed by from a request.
+type KeyFunc func(*http.Request) string
+
+// ParseKeyFunc builds the KeyFunc named by the `--rate-key` flag:
+// "ip" (default), "path", or "header:<Name>".
+func ParseKeyFunc(spec string) (KeyFunc, error) {
+	switch {
+	case spec == "" || spec == "ip":
+		return ipKeyFunc, nil
+	case spec == "path":
+		return pathKeyFunc, nil
+	case strings.HasPrefix(spec, "header:"):
+		return headerKeyFunc(strings.TrimPrefix(spec, "header:")), nil
+	default:
+		return nil, fmt.Errorf("middleware: unknown rate limit key %q", spec)
+	}
+}
+
+func ipKeyFunc(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func pathKeyFunc(r *http.Request) string { return r.URL.Path }
+
+func headerKeyFunc(header string) KeyFunc {
+	return func(r *http.Request) string { return r.Header.Get(header) }
+}
+
+// bucket holds one client's token-bucket state. It is only ever
+// accessed while its owning shard's lock is held.
+type bucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// shard is one independently-locked slice of the bucket map.
+type shard struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// Result describes the outcome of a single Allow check.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// RateLimiter implements a token-bucket rate limiting algorithm, keyed
+// per client by KeyFunc. Each key gets its own bucket that refills at
+// `rate` tokens per second up to `burst` tokens, so a client can burst
+// up to `burst` requests before being limited to the steady-state rate.
+// Buckets are sharded across independent locks so one busy client
+// doesn't serialize requests from everyone else.
 type RateLimiter struct {
-	mu         sync.Mutex
-	timestamps []time.Time
-	rps        int
+	rate    float64
+	burst   float64
+	keyFunc KeyFunc
+	shards  []*shard
+	stopCh  chan struct{}
 }
 
 // NewRateLimiter creates a new rate limiter instance.
 // Parameters:
-//   - rps: Maximum number of requests allowed per second
+//   - rps: Token refill rate, in requests per second
+//   - burst: Maximum tokens a bucket can hold; non-positive falls back to rps
+//   - keyFunc: Extracts the per-client key a bucket is tracked by; nil falls back to the client IP
 //
 // Returns:
-//   - *RateLimiter: A new rate limiter configured with the specified RPS
-func NewRateLimiter(rps int) *RateLimiter {
-	return &RateLimiter{
-		timestamps: make([]time.Time, 0, rps),
-		rps:        rps,
+//   - *RateLimiter: A new rate limiter configured with the specified rate and burst
+func NewRateLimiter(rps, burst int, keyFunc KeyFunc) *RateLimiter {
+	if burst <= 0 {
+		burst = rps
+	}
+	if keyFunc == nil {
+		keyFunc = ipKeyFunc
 	}
+
+	rl := &RateLimiter{
+		rate:    float64(rps),
+		burst:   float64(burst),
+		keyFunc: keyFunc,
+		shards:  make([]*shard, shardCount),
+		stopCh:  make(chan struct{}),
+	}
+	for i := range rl.shards {
+		rl.shards[i] = &shard{buckets: make(map[string]*bucket)}
+	}
+
+	go rl.runJanitor()
+	return rl
+}
+
+// shardFor deterministically maps a key onto one of the limiter's shards.
+func (rl *RateLimiter) shardFor(key string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return rl.shards[h.Sum32()%uint32(len(rl.shards))]
 }
 
-// Allow checks if a new request should be allowed based on the rate limit.
-// Uses a sliding window of 1 second to determine if the request can proceed.
+// Allow checks whether a request for the given key should proceed,
+// refilling and deducting from that key's token bucket.
 // Returns:
-//   - bool: true if request is allowed, false if rate limit exceeded
-func (rl *RateLimiter) Allow() bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+//   - Result: Whether the request is allowed, plus the limit, remaining tokens, and (if denied) a Retry-After duration
+func (rl *RateLimiter) Allow(key string) Result {
+	s := rl.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	now := time.Now()
-	window := now.Add(-time.Second)
-
-	// Remove timestamps older than 1 second from the window
-	valid := 0
-	for _, ts := range rl.timestamps {
-		if ts.After(window) {
-			rl.timestamps[valid] = ts
-			valid++
-		}
+	b, exists := s.buckets[key]
+	if !exists {
+		b = &bucket{tokens: rl.burst, lastRefill: now}
+		s.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.lastRefill).Seconds()
+		b.tokens = math.Min(rl.burst, b.tokens+elapsed*rl.rate)
+		b.lastRefill = now
 	}
-	rl.timestamps = rl.timestamps[:valid]
 
-	// Allow request if under RPS limit
-	if len(rl.timestamps) < rl.rps {
-		rl.timestamps = append(rl.timestamps, now)
-		return true
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true, Limit: int(rl.burst), Remaining: int(b.tokens)}
 	}
-	return false
+
+	retryAfter := time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	return Result{Allowed: false, Limit: int(rl.burst), Remaining: 0, RetryAfter: retryAfter}
 }
 
-// Middleware wraps an http.Handler with rate limiting functionality.
+// runJanitor periodically evicts buckets that have been idle long
+// enough that they'd have fully refilled anyway, bounding the bucket
+// map's memory use under a large number of distinct clients.
+func (rl *RateLimiter) runJanitor() {
+	idleThreshold := time.Duration(10 * (rl.burst / rl.rate) * float64(time.Second))
+	if idleThreshold <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(idleThreshold / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rl.stopCh:
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Add(-idleThreshold)
+			for _, s := range rl.shards {
+				s.mu.Lock()
+				for key, b := range s.buckets {
+					if b.lastRefill.Before(cutoff) {
+						delete(s.buckets, key)
+					}
+				}
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Stop terminates the janitor goroutine. Callers must not use the
+// RateLimiter afterward; it exists so Server.Reload can retire the old
+// runtime's limiter instead of leaking its goroutine on every reload.
+func (rl *RateLimiter) Stop() {
+	close(rl.stopCh)
+}
+
+// Middleware wraps an http.Handler with token-bucket rate limiting.
+// It always sets X-RateLimit-Limit and X-RateLimit-Remaining, and adds
+// Retry-After when a request is denied with 429.
 // Parameters:
 //   - next: The handler to wrap with rate limiting
 //
@@ -68,13 +203,20 @@ func (rl *RateLimiter) Allow() bool {
 //   - http.Handler: A new handler that enforces rate limiting
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !rl.Allow() {
+		result := rl.Allow(rl.keyFunc(r))
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
 			errors.HandleError(w, errors.HTTPError{
 				Status:  http.StatusTooManyRequests,
 				Message: "Rate limit exceeded",
 			}, log.Default())
 			return
 		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -1,7 +1,12 @@
 // Response writer middleware to capture the status code
 package middleware
 
-import "net/http"
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
 
 // ResponseWriter wraps http.ResponseWriter to capture the status code
 type ResponseWriter struct {
@@ -14,3 +19,23 @@ func (rw *ResponseWriter) WriteHeader(code int) {
 	rw.StatusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Flush passes through to the underlying ResponseWriter's Flush, so a
+// wrapped writer still satisfies http.Flusher for streamed responses
+// (SSE, chunked transfer) instead of silently buffering them.
+func (rw *ResponseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes through to the underlying ResponseWriter's Hijack, so a
+// wrapped writer still satisfies http.Hijacker for protocol upgrades
+// (WebSockets) instead of forcing httputil.ReverseProxy to fail them.
+func (rw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("middleware: underlying ResponseWriter does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"reverse_proxy/internal/config"
+	"reverse_proxy/internal/errors"
+	"reverse_proxy/internal/loadbalancer"
+	"reverse_proxy/internal/metrics"
+	"reverse_proxy/internal/middleware"
+)
+
+// fcgiScheme is the `--backends` prefix that routes a backend through
+// the FastCGI transport instead of plain HTTP.
+const fcgiScheme = "fcgi://"
+
+// backendCtxKey is the context key under which the selected backend for
+// a request is stashed, so the Director, ModifyResponse, and
+// ErrorHandler hooks of the underlying httputil.ReverseProxy can all
+// see the same backend without re-running the load balancer's policy.
+type backendCtxKey struct{}
+
+// ProxyHandler implements the core reverse proxy functionality.
+// It selects a backend via the load balancer and forwards the request
+// through an httputil.ReverseProxy, which streams the response back to
+// the client, propagates upstream headers and status codes, strips
+// hop-by-hop headers, and transparently handles Upgrade (WebSocket)
+// requests.
+type ProxyHandler struct {
+	srv          *Server
+	metrics      *metrics.Metrics
+	reverseProxy *httputil.ReverseProxy
+}
+
+// newProxyHandler builds a ProxyHandler and the httputil.ReverseProxy it
+// delegates to. It reads the load balancer and circuit breaker from
+// srv.runtime() on every request rather than capturing them once, so a
+// reload takes effect for the very next request without rebuilding the
+// handler.
+func newProxyHandler(srv *Server, m *metrics.Metrics, cfg *config.Config) *ProxyHandler {
+	p := &ProxyHandler{
+		srv:     srv,
+		metrics: m,
+	}
+
+	p.reverseProxy = &httputil.ReverseProxy{
+		Director:       p.director,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.errorHandler,
+		FlushInterval:  cfg.FlushInterval,
+		Transport:      newTransport(cfg),
+	}
+
+	return p
+}
+
+// ServeHTTP implements http.Handler interface for the proxy.
+// It selects a backend, tracks in-flight requests and metrics, and
+// hands the request to the underlying httputil.ReverseProxy for
+// forwarding.
+func (p *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.metrics.IncRequest()
+
+	backend := p.srv.runtime().lb.Next(r)
+	if backend == nil {
+		p.metrics.IncError()
+		errors.HandleError(w, errors.HTTPError{
+			Status:  http.StatusServiceUnavailable,
+			Message: "No backends available",
+		}, log.Default())
+		return
+	}
+
+	backend.IncInFlight()
+	start := time.Now()
+	rw := &middleware.ResponseWriter{ResponseWriter: w}
+	ctx := context.WithValue(r.Context(), backendCtxKey{}, backend)
+	p.reverseProxy.ServeHTTP(rw, r.WithContext(ctx))
+
+	status := rw.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	p.metrics.ObserveRequest(r.Method, backend.URL, status, time.Since(start))
+}
+
+// director rewrites the outgoing request to target the backend chosen
+// by ServeHTTP, and appends the standard X-Forwarded-* headers so the
+// backend can see the original client and host.
+func (p *ProxyHandler) director(r *http.Request) {
+	backend, _ := r.Context().Value(backendCtxKey{}).(*loadbalancer.Backend)
+	if backend == nil {
+		return
+	}
+
+	originalHost := r.Host
+
+	if strings.HasPrefix(backend.URL, fcgiScheme) {
+		// Carry the socket address in Opaque rather than Host: a
+		// `unix:/path` authority would otherwise be misparsed as a
+		// hostname with an invalid port by net/url.
+		r.URL.Scheme = "fcgi"
+		r.URL.Opaque = strings.TrimPrefix(backend.URL, fcgiScheme)
+		r.URL.Host = ""
+	} else if target, err := url.Parse(backend.URL); err == nil {
+		r.URL.Scheme = target.Scheme
+		r.URL.Host = target.Host
+		r.Host = target.Host
+	}
+
+	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+			clientIP = prior + ", " + clientIP
+		}
+		r.Header.Set("X-Forwarded-For", clientIP)
+	}
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	r.Header.Set("X-Forwarded-Proto", proto)
+	r.Header.Set("X-Forwarded-Host", originalHost)
+}
+
+// modifyResponse records a successful round trip against the backend's
+// circuit breaker and metrics, and releases the backend's in-flight
+// slot once the response body has been fully streamed to the client.
+func (p *ProxyHandler) modifyResponse(resp *http.Response) error {
+	backend, _ := resp.Request.Context().Value(backendCtxKey{}).(*loadbalancer.Backend)
+	if backend != nil {
+		p.srv.runtime().circuitBreak.OnBackendSuccess(backend.URL)
+		resp.Body = &releaseOnCloseBody{ReadCloser: resp.Body, release: backend.DecInFlight}
+	}
+
+	p.metrics.IncResponse()
+	return nil
+}
+
+// errorHandler is invoked when the reverse proxy fails to complete the
+// round trip to the backend. A canceled request context means the
+// client disconnected before the backend responded, which is tracked
+// separately from a genuine backend failure and does not trip the
+// circuit breaker.
+func (p *ProxyHandler) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	backend, _ := r.Context().Value(backendCtxKey{}).(*loadbalancer.Backend)
+	if backend != nil {
+		backend.DecInFlight()
+	}
+
+	if stderrors.Is(err, context.Canceled) {
+		p.metrics.IncClientDisconnect()
+		log.Printf("Client disconnected: method=%s path=%s", r.Method, r.URL.Path)
+		w.WriteHeader(499)
+		return
+	}
+
+	if backend != nil {
+		p.srv.runtime().circuitBreak.OnBackendFailure(backend.URL)
+	}
+	p.metrics.IncError()
+	errors.HandleError(w, errors.HTTPError{
+		Status:  http.StatusBadGateway,
+		Message: "Error forwarding request",
+	}, log.Default())
+}
+
+// releaseOnCloseBody wraps a response body so that release runs exactly
+// once the body is closed, i.e. once the reverse proxy has finished
+// streaming it to the client.
+type releaseOnCloseBody struct {
+	io.ReadCloser
+	release func()
+	closed  bool
+}
+
+func (b *releaseOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	if !b.closed {
+		b.closed = true
+		b.release()
+	}
+	return err
+}
+
+// Write passes through to the underlying body when it is itself an
+// io.Writer, which httputil.ReverseProxy relies on for a 101 Switching
+// Protocols response: it hijacks the backend connection and hands it
+// back as resp.Body so both directions of the upgraded connection (e.g.
+// a WebSocket) can be copied. Without this, wrapping the body here
+// would make it read-only and the upgrade would be rejected.
+func (b *releaseOnCloseBody) Write(p []byte) (int, error) {
+	w, ok := b.ReadCloser.(io.Writer)
+	if !ok {
+		return 0, fmt.Errorf("proxy: underlying response body is not writable")
+	}
+	return w.Write(p)
+}
@@ -0,0 +1,37 @@
+package proxy
+
+// metricsBackendSource adapts the server's current runtime (its load
+// balancer, health checker, and circuit breaker) to the narrow
+// interface the metrics package uses to render its per-backend
+// Prometheus gauges. It reads the runtime fresh on every call rather
+// than holding it directly, so a reload is reflected without having to
+// re-register the source on the Metrics instance.
+type metricsBackendSource struct {
+	srv *Server
+}
+
+func (s *metricsBackendSource) Backends() []string {
+	backends := s.srv.runtime().lb.Backends()
+	urls := make([]string, len(backends))
+	for i, backend := range backends {
+		urls[i] = backend.URL
+	}
+	return urls
+}
+
+func (s *metricsBackendSource) InFlight(backend string) int64 {
+	for _, b := range s.srv.runtime().lb.Backends() {
+		if b.URL == backend {
+			return b.LoadInFlight()
+		}
+	}
+	return 0
+}
+
+func (s *metricsBackendSource) IsHealthy(backend string) bool {
+	return s.srv.runtime().health.IsHealthy(backend)
+}
+
+func (s *metricsBackendSource) CircuitState(backend string) int {
+	return int(s.srv.runtime().circuitBreak.State(backend))
+}
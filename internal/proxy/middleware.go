@@ -0,0 +1,21 @@
+package proxy
+
+import "net/http"
+
+// rateLimitMiddleware adapts the server's current runtime to
+// middleware.Middleware. It re-reads s.runtime() on every request
+// rather than closing over a fixed RateLimiter, so a reload takes
+// effect for the very next request without rebuilding the handler
+// chain.
+//
+// There is no equivalent circuitBreakMiddleware: circuit breaking is
+// enforced per backend inside LoadBalancer.Next (and ProxyHandler's
+// success/failure reporting), which runs after a backend is chosen. An
+// outer CircuitBreaker.Middleware gate keyed on r.URL.Host would run
+// before backend selection, collapse every backend onto one shared
+// circuit, and conflict with the per-backend tracking below it.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.runtime().limiter.Middleware(next).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"net/http"
+
+	"reverse_proxy/internal/config"
+	"reverse_proxy/internal/health"
+	"reverse_proxy/internal/loadbalancer"
+	"reverse_proxy/internal/middleware"
+)
+
+// runtime bundles every component whose wiring depends on the current
+// Config: the circuit breaker, active health checker, load balancer,
+// and rate limiter. The server holds the current runtime behind an
+// atomic.Value so a reload can swap in a freshly built one without
+// taking a lock on the request path; in-flight requests keep the
+// runtime they were dispatched against, and only new requests observe
+// the swap.
+type runtime struct {
+	cfg          *config.Config
+	circuitBreak *middleware.CircuitBreaker
+	health       *health.Checker
+	lb           *loadbalancer.LoadBalancer
+	limiter      *middleware.RateLimiter
+}
+
+// buildRuntime constructs a runtime from cfg, mirroring the wiring
+// NewServer has always done, but returning an error instead of calling
+// log.Fatalf so a bad reload can be rejected without taking down an
+// already-running server.
+func buildRuntime(cfg *config.Config) (*runtime, error) {
+	cb := middleware.NewCircuitBreaker(cfg.CBFailureThreshold, cfg.CBTimeout)
+
+	backendURLs := make([]string, len(cfg.Backends))
+	for i, spec := range cfg.Backends {
+		backendURLs[i], _ = loadbalancer.ParseBackendSpec(spec)
+	}
+
+	hc := health.New(backendURLs, health.Config{
+		Path:               cfg.HealthPath,
+		Interval:           cfg.HealthInterval,
+		Timeout:            cfg.HealthTimeout,
+		ExpectedStatus:     http.StatusOK,
+		UnhealthyThreshold: cfg.UnhealthyThreshold,
+		HealthyThreshold:   cfg.HealthyThreshold,
+	}, cb)
+
+	policy, err := loadbalancer.NewPolicy(cfg.LBPolicy, cfg.LBHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	rateKey, err := middleware.ParseKeyFunc(cfg.RateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	lb := loadbalancer.New(cfg.Backends, cb, hc, policy)
+	limiter := middleware.NewRateLimiter(cfg.RateLimit, cfg.RateLimitBurst, rateKey)
+
+	return &runtime{
+		cfg:          cfg,
+		circuitBreak: cb,
+		health:       hc,
+		lb:           lb,
+		limiter:      limiter,
+	}, nil
+}
@@ -4,14 +4,16 @@ package proxy
 
 import (
 	"encoding/json"
-	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"reverse_proxy/internal/config"
-	"reverse_proxy/internal/errors"
-	"reverse_proxy/internal/loadbalancer"
 	"reverse_proxy/internal/metrics"
 	"reverse_proxy/internal/middleware"
 )
@@ -20,14 +22,17 @@ import (
 var startTime = time.Now()
 
 // Server represents the main reverse proxy server.
-// It coordinates all components including configuration, metrics,
-// rate limiting, load balancing, and circuit breaker.
+// It coordinates configuration, metrics, and the current runtime
+// (load balancer, rate limiter, circuit breaker, and health checker).
+// The runtime is held behind an atomic.Value so requests read it
+// lock-free, and Reload can swap in a freshly built one - re-read from
+// cfg.ConfigPath on SIGHUP or POST /admin/reload - without dropping
+// requests already in flight against the old one.
 type Server struct {
-	cfg          *config.Config
-	metrics      *metrics.Metrics
-	limiter      *middleware.RateLimiter
-	lb           *loadbalancer.LoadBalancer
-	circuitBreak *middleware.CircuitBreaker
+	metrics *metrics.Metrics
+
+	current  atomic.Value // holds *runtime
+	reloadMu sync.Mutex   // serializes concurrent SIGHUP/admin reloads
 }
 
 // NewServer creates a new reverse proxy server instance.
@@ -37,149 +42,168 @@ type Server struct {
 // Returns:
 //   - *Server: Configured server instance with all components initialized
 func NewServer(cfg *config.Config) *Server {
-	cb := middleware.NewCircuitBreaker()
-	return &Server{
-		cfg:          cfg,
-		metrics:      metrics.New(),
-		limiter:      middleware.NewRateLimiter(cfg.RateLimit),
-		lb:           loadbalancer.New(cfg.Backends, cb),
-		circuitBreak: cb,
+	rt, err := buildRuntime(cfg)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
 	}
-}
 
-// Run starts the HTTP server and begins processing requests.
-// It configures the server with timeouts and handlers, then
-// blocks until the server encounters an error or is shutdown.
-// Returns:
-//   - error: Any error that caused the server to stop
-func (s *Server) Run() error {
-	handler := s.createHandler()
+	s := &Server{metrics: metrics.New(cfg.MetricsBuckets)}
+	s.current.Store(rt)
+	s.metrics.RegisterBackends(&metricsBackendSource{srv: s})
 
-	server := &http.Server{
-		Addr:         s.cfg.ListenAddr,
-		Handler:      handler,
-		ReadTimeout:  s.cfg.ReadTimeout,
-		WriteTimeout: s.cfg.WriteTimeout,
-	}
-
-	return server.ListenAndServe()
+	return s
 }
 
-// ProxyHandler implements the core reverse proxy functionality.
-// It forwards requests to backend servers and tracks metrics.
-type ProxyHandler struct {
-	lb           *loadbalancer.LoadBalancer
-	metrics      *metrics.Metrics
-	config       *config.Config
-	circuitBreak *middleware.CircuitBreaker
+// runtime returns the server's current runtime.
+func (s *Server) runtime() *runtime {
+	return s.current.Load().(*runtime)
 }
 
-// ServeHTTP implements http.Handler interface for the proxy.
-// It handles incoming requests by:
-// 1. Selecting a backend server
-// 2. Creating and forwarding the proxy request
-// 3. Returning the response to the client
-// 4. Tracking metrics for the request
-func (p *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	p.metrics.IncRequest()
-	wrapped := &middleware.ResponseWriter{ResponseWriter: w}
-
-	backend := p.lb.Next()
-	if backend == "" {
-		p.metrics.IncError()
-		errors.HandleError(wrapped, errors.HTTPError{
-			Status:  http.StatusServiceUnavailable,
-			Message: "No backends available",
-		}, log.Default())
-		return
-	}
-
-	// Create proxy request
-	targetURL := backend + r.URL.Path
-	if r.URL.RawQuery != "" {
-		targetURL += "?" + r.URL.RawQuery
+// Reload re-reads the config file at the current runtime's
+// cfg.ConfigPath and, if it parses and builds cleanly, atomically swaps
+// it in as the new runtime. It is a no-op error for flag-only servers,
+// which have no file to re-read. The old runtime's health checker and
+// rate limiter are stopped only after the swap - the health checker so
+// backends never go unmonitored, the rate limiter so its janitor
+// goroutine doesn't leak.
+func (s *Server) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	old := s.runtime()
+	if old.cfg.ConfigPath == "" {
+		return errNoConfigFile
 	}
 
-	proxyReq, err := http.NewRequest(r.Method, targetURL, r.Body)
+	cfg, err := config.LoadFile(old.cfg.ConfigPath)
 	if err != nil {
-		p.metrics.IncError()
-		errors.HandleError(wrapped, errors.HTTPError{
-			Status:  http.StatusInternalServerError,
-			Message: "Error creating proxy request",
-		}, log.Default())
-		return
+		return err
 	}
 
-	// Forward request
-	client := &http.Client{Timeout: p.config.WriteTimeout}
-	resp, err := client.Do(proxyReq)
+	rt, err := buildRuntime(cfg)
 	if err != nil {
-		p.metrics.IncError()
-		p.circuitBreak.OnBackendFailure(backend)
-		errors.HandleError(wrapped, errors.HTTPError{
-			Status:  http.StatusBadGateway,
-			Message: "Error forwarding request",
-		}, log.Default())
-		return
+		return err
 	}
-	defer resp.Body.Close()
 
-	p.circuitBreak.OnBackendSuccess(backend)
+	rt.health.Start()
+	s.current.Store(rt)
+	old.health.Stop()
+	old.limiter.Stop()
+
+	log.Printf("Reloaded configuration from %s", cfg.ConfigPath)
+	return nil
+}
+
+var errNoConfigFile = &reloadError{"server is not running from a --config file"}
+
+// reloadError reports why a reload was refused.
+type reloadError struct{ msg string }
+
+func (e *reloadError) Error() string { return e.msg }
+
+// Run starts the HTTP server and begins processing requests.
+// It starts the active health checker, installs the SIGHUP reload
+// handler, configures the server with timeouts and handlers, then
+// blocks until the server encounters an error or is shutdown.
+// Returns:
+//   - error: Any error that caused the server to stop
+func (s *Server) Run() error {
+	rt := s.runtime()
+	rt.health.Start()
+	defer rt.health.Stop()
+
+	s.watchReloadSignal()
+
+	handler := s.createHandler()
 
-	if _, err := io.Copy(wrapped, resp.Body); err != nil {
-		p.metrics.IncError()
-		errors.HandleError(wrapped, errors.HTTPError{
-			Status:  http.StatusInternalServerError,
-			Message: "Error copying response",
-		}, log.Default())
-		return
+	server := &http.Server{
+		Addr:         rt.cfg.ListenAddr,
+		Handler:      handler,
+		ReadTimeout:  rt.cfg.ReadTimeout,
+		WriteTimeout: rt.cfg.WriteTimeout,
 	}
 
-	p.metrics.IncResponse()
+	return server.ListenAndServe()
+}
+
+// watchReloadSignal starts a goroutine that calls Reload on every
+// SIGHUP, so an operator can update the backend list, limits, and
+// thresholds in the config file and apply them with `kill -HUP`
+// instead of a restart.
+func (s *Server) watchReloadSignal() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		for range sighup {
+			if err := s.Reload(); err != nil {
+				log.Printf("SIGHUP reload failed: %v", err)
+			}
+		}
+	}()
 }
 
 // createHandler sets up the HTTP request processing pipeline.
 // It configures:
 // 1. The main proxy handler
 // 2. Middleware chain (rate limiting, logging)
-// 3. Routes for health checks and metrics
+// 3. Routes for health checks, metrics, and admin reload
 // Returns:
 //   - http.Handler: The fully configured request handler
 func (s *Server) createHandler() http.Handler {
-	proxy := &ProxyHandler{
-		lb:           s.lb,
-		metrics:      s.metrics,
-		config:       s.cfg,
-		circuitBreak: s.circuitBreak,
-	}
+	proxy := newProxyHandler(s, s.metrics, s.runtime().cfg)
 
 	handler := middleware.Chain(
 		proxy,
-		s.limiter.Middleware,
-		s.circuitBreak.Middleware,
+		s.rateLimitMiddleware,
 		middleware.Logging,
 	)
 
 	mux := http.NewServeMux()
 	mux.Handle("/", handler)
-	mux.Handle("/health", healthHandler())
-	mux.Handle("/metrics", s.metrics.Handler())
+	mux.Handle("/health", s.healthHandler())
+	mux.Handle("/metrics", s.metrics.FormatHandler(s.runtime().cfg.MetricsFormat))
+	mux.Handle("/admin/reload", s.adminReloadHandler())
 
 	return mux
 }
 
 // healthHandler returns an HTTP handler for health checks.
-// It responds with server status and uptime information in JSON format.
+// It responds with server status, uptime, and the per-backend
+// healthiness reported by the active health checker, in JSON format.
 // Returns:
 //   - http.Handler: Health check endpoint handler
-func healthHandler() http.Handler {
+func (s *Server) healthHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		health := map[string]interface{}{
-			"status": "UP",
-			"uptime": time.Since(startTime).String(),
+			"status":   "UP",
+			"uptime":   time.Since(startTime).String(),
+			"backends": s.runtime().health.Snapshot(),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(health)
 	})
 }
+
+// adminReloadHandler returns an HTTP handler for POST /admin/reload. It
+// re-reads the config file backing the current runtime and swaps it in,
+// giving operators an HTTP-reachable equivalent to `kill -HUP`.
+func (s *Server) adminReloadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := s.Reload(); err != nil {
+			log.Printf("admin reload failed: %v", err)
+			http.Error(w, "reload failed, see server logs", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "reloaded"})
+	})
+}
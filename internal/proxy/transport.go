@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"net/http"
+
+	"reverse_proxy/internal/config"
+	"reverse_proxy/internal/transport/fastcgi"
+)
+
+// dispatchTransport routes each request to the HTTP or FastCGI
+// transport depending on the scheme the Director assigned it, so
+// httputil.ReverseProxy can front a mix of plain HTTP and fcgi://
+// backends behind a single Transport.
+type dispatchTransport struct {
+	http *http.Transport
+	fcgi *fastcgi.RoundTripper
+}
+
+// newTransport builds the Transport used by the reverse proxy's HTTP
+// client, dispatching fcgi:// requests to the FastCGI transport and
+// everything else to a standard http.Transport.
+func newTransport(cfg *config.Config) http.RoundTripper {
+	return &dispatchTransport{
+		http: &http.Transport{ResponseHeaderTimeout: cfg.WriteTimeout},
+		fcgi: fastcgi.NewRoundTripper(cfg.FCGIRoot, cfg.WriteTimeout),
+	}
+}
+
+func (t *dispatchTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Scheme == "fcgi" {
+		return t.fcgi.RoundTrip(r)
+	}
+	return t.http.RoundTrip(r)
+}
@@ -0,0 +1,161 @@
+package fastcgi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// FastCGI 1.0 record types and the Responder role, as defined by the
+// FastCGI specification.
+const (
+	typeBeginRequest = 1
+	typeAbortRequest = 2
+	typeEndRequest   = 3
+	typeParams       = 4
+	typeStdin        = 5
+	typeStdout       = 6
+	typeStderr       = 7
+
+	roleResponder = 1
+
+	fcgiVersion1 = 1
+
+	// maxContentLength is the largest content payload a single record can
+	// carry; the FastCGI spec limits contentLength to a 16-bit field.
+	maxContentLength = 65535
+)
+
+// header is the fixed 8-byte FastCGI record header that precedes every
+// record on the wire.
+type header struct {
+	version       uint8
+	recType       uint8
+	requestID     uint16
+	contentLength uint16
+	paddingLength uint8
+}
+
+// writeRecord writes a single FastCGI record, padding its content out to
+// an 8-byte boundary as recommended (but not required) by the spec.
+func writeRecord(w io.Writer, recType uint8, reqID uint16, content []byte) error {
+	if len(content) > maxContentLength {
+		return fmt.Errorf("fastcgi: record content too large: %d bytes", len(content))
+	}
+
+	padLen := (8 - (len(content) % 8)) % 8
+
+	buf := make([]byte, 8, 8+len(content)+padLen)
+	buf[0] = fcgiVersion1
+	buf[1] = recType
+	binary.BigEndian.PutUint16(buf[2:4], reqID)
+	binary.BigEndian.PutUint16(buf[4:6], uint16(len(content)))
+	buf[6] = uint8(padLen)
+	buf[7] = 0
+
+	buf = append(buf, content...)
+	buf = append(buf, make([]byte, padLen)...)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// writeStream splits r into up-to-maxContentLength chunks and writes
+// each as its own record of type recType, followed by an empty
+// terminating record as required by the spec for PARAMS and STDIN.
+func writeStream(w io.Writer, recType uint8, reqID uint16, r io.Reader) error {
+	buf := make([]byte, maxContentLength)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if werr := writeRecord(w, recType, reqID, buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writeRecord(w, recType, reqID, nil)
+}
+
+// readHeader reads and decodes a single record header from r.
+func readHeader(r io.Reader) (header, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return header{}, err
+	}
+
+	return header{
+		version:       buf[0],
+		recType:       buf[1],
+		requestID:     binary.BigEndian.Uint16(buf[2:4]),
+		contentLength: binary.BigEndian.Uint16(buf[4:6]),
+		paddingLength: buf[6],
+	}, nil
+}
+
+// readRecord reads one full record (header, content, and padding) from r.
+func readRecord(r io.Reader) (header, []byte, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return header{}, nil, err
+	}
+
+	content := make([]byte, h.contentLength)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return header{}, nil, err
+	}
+
+	if h.paddingLength > 0 {
+		if _, err := io.CopyN(io.Discard, r, int64(h.paddingLength)); err != nil {
+			return header{}, nil, err
+		}
+	}
+
+	return h, content, nil
+}
+
+// encodeParam encodes a single name/value pair using the FastCGI PARAMS
+// length encoding: lengths up to 127 bytes use a single length byte,
+// longer lengths use a 4-byte length with the high bit set.
+func encodeParam(name, value string) []byte {
+	var buf bytes.Buffer
+	writeLength(&buf, len(name))
+	writeLength(&buf, len(value))
+	buf.WriteString(name)
+	buf.WriteString(value)
+	return buf.Bytes()
+}
+
+func writeLength(buf *bytes.Buffer, n int) {
+	if n <= 127 {
+		buf.WriteByte(byte(n))
+		return
+	}
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(n)|0x80000000)
+	buf.Write(lenBuf[:])
+}
+
+// writeBeginRequest writes the BEGIN_REQUEST record that opens a request.
+func writeBeginRequest(w io.Writer, reqID uint16, role uint16, flags uint8) error {
+	body := make([]byte, 8)
+	binary.BigEndian.PutUint16(body[0:2], role)
+	body[2] = flags
+	return writeRecord(w, typeBeginRequest, reqID, body)
+}
+
+// writeParams encodes every entry in params and writes them as one or
+// more PARAMS records, terminated by an empty PARAMS record.
+func writeParams(w io.Writer, reqID uint16, params map[string]string) error {
+	var buf bytes.Buffer
+	for name, value := range params {
+		buf.Write(encodeParam(name, value))
+	}
+	return writeStream(w, typeParams, reqID, &buf)
+}
@@ -0,0 +1,163 @@
+package fastcgi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestWriteReadRecordRoundTrip checks that a record survives encode then
+// decode unchanged, for both sub-block and exactly-block-aligned content
+// lengths (padLen should be 0 in the latter case).
+func TestWriteReadRecordRoundTrip(t *testing.T) {
+	cases := []struct {
+		name    string
+		content []byte
+	}{
+		{"empty", nil},
+		{"needs padding", []byte("hello")},
+		{"block aligned", []byte("01234567")},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeRecord(&buf, typeStdout, 42, tc.content); err != nil {
+				t.Fatalf("writeRecord: %v", err)
+			}
+
+			h, content, err := readRecord(&buf)
+			if err != nil {
+				t.Fatalf("readRecord: %v", err)
+			}
+			if h.version != fcgiVersion1 {
+				t.Errorf("version = %d, want %d", h.version, fcgiVersion1)
+			}
+			if h.recType != typeStdout {
+				t.Errorf("recType = %d, want %d", h.recType, typeStdout)
+			}
+			if h.requestID != 42 {
+				t.Errorf("requestID = %d, want 42", h.requestID)
+			}
+			if !bytes.Equal(content, tc.content) {
+				t.Errorf("content = %q, want %q", content, tc.content)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("%d bytes left unread after record, padding not fully consumed", buf.Len())
+			}
+		})
+	}
+}
+
+// TestWriteRecordRejectsOversizedContent checks the maxContentLength
+// guard, since contentLength is a 16-bit field on the wire.
+func TestWriteRecordRejectsOversizedContent(t *testing.T) {
+	var buf bytes.Buffer
+	content := make([]byte, maxContentLength+1)
+	if err := writeRecord(&buf, typeStdout, 1, content); err == nil {
+		t.Fatal("writeRecord: expected error for oversized content, got nil")
+	}
+}
+
+// TestWriteStreamChunksAtMaxContentLength checks that a stream larger
+// than maxContentLength is split across multiple records, plus the
+// empty terminating record required for PARAMS/STDIN.
+func TestWriteStreamChunksAtMaxContentLength(t *testing.T) {
+	total := maxContentLength*2 + 10
+	payload := strings.Repeat("a", total)
+
+	var buf bytes.Buffer
+	if err := writeStream(&buf, typeStdin, 7, strings.NewReader(payload)); err != nil {
+		t.Fatalf("writeStream: %v", err)
+	}
+
+	var gotRecords [][]byte
+	for buf.Len() > 0 {
+		h, content, err := readRecord(&buf)
+		if err != nil {
+			t.Fatalf("readRecord: %v", err)
+		}
+		if h.requestID != 7 {
+			t.Errorf("requestID = %d, want 7", h.requestID)
+		}
+		gotRecords = append(gotRecords, content)
+	}
+
+	wantRecords := 4 // two full maxContentLength chunks, one short chunk, one empty terminator
+	if len(gotRecords) != wantRecords {
+		t.Fatalf("got %d records, want %d", len(gotRecords), wantRecords)
+	}
+
+	last := gotRecords[len(gotRecords)-1]
+	if len(last) != 0 {
+		t.Errorf("final record content = %d bytes, want empty terminator", len(last))
+	}
+
+	var reassembled []byte
+	for _, r := range gotRecords[:len(gotRecords)-1] {
+		reassembled = append(reassembled, r...)
+	}
+	if string(reassembled) != payload {
+		t.Error("reassembled stream content does not match original payload")
+	}
+}
+
+// TestEncodeParamRoundTrip checks encodeParam's length-prefix encoding
+// for both the short (<=127 byte) and long length forms.
+func TestEncodeParamRoundTrip(t *testing.T) {
+	longValue := strings.Repeat("v", 200)
+
+	cases := []struct {
+		name, value string
+	}{
+		{"SCRIPT_NAME", "/index.php"},
+		{"LONG_VALUE", longValue},
+	}
+
+	for _, tc := range cases {
+		encoded := encodeParam(tc.name, tc.value)
+
+		name, value, rest := decodeParam(t, encoded)
+		if name != tc.name {
+			t.Errorf("name = %q, want %q", name, tc.name)
+		}
+		if value != tc.value {
+			t.Errorf("value mismatch for %q", tc.name)
+		}
+		if len(rest) != 0 {
+			t.Errorf("%d trailing bytes after decoding param", len(rest))
+		}
+	}
+}
+
+// decodeParam decodes a single name/value pair using the same
+// length-prefix rules as encodeParam, returning any bytes left over.
+func decodeParam(t *testing.T, buf []byte) (name, value string, rest []byte) {
+	t.Helper()
+
+	nameLen, buf := readLength(t, buf)
+	valueLen, buf := readLength(t, buf)
+
+	if len(buf) < nameLen+valueLen {
+		t.Fatalf("buffer too short: have %d bytes, want %d", len(buf), nameLen+valueLen)
+	}
+	name = string(buf[:nameLen])
+	value = string(buf[nameLen : nameLen+valueLen])
+	return name, value, buf[nameLen+valueLen:]
+}
+
+func readLength(t *testing.T, buf []byte) (int, []byte) {
+	t.Helper()
+
+	if len(buf) == 0 {
+		t.Fatal("readLength: empty buffer")
+	}
+	if buf[0]&0x80 == 0 {
+		return int(buf[0]), buf[1:]
+	}
+	if len(buf) < 4 {
+		t.Fatal("readLength: truncated 4-byte length")
+	}
+	n := int(buf[0]&0x7f)<<24 | int(buf[1])<<16 | int(buf[2])<<8 | int(buf[3])
+	return n, buf[4:]
+}
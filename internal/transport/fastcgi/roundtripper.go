@@ -0,0 +1,230 @@
+package fastcgi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RoundTripper adapts the FastCGI protocol to http.RoundTripper so a
+// FastCGI application server can be used as an httputil.ReverseProxy
+// backend alongside plain HTTP upstreams.
+type RoundTripper struct {
+	// DocumentRoot is used as CGI's DOCUMENT_ROOT and to build
+	// SCRIPT_FILENAME for the requested path.
+	DocumentRoot string
+	// Timeout bounds both connection dialing and the round trip to the
+	// application server.
+	Timeout time.Duration
+
+	pool *connPool
+}
+
+// NewRoundTripper creates a RoundTripper backed by its own connection pool.
+func NewRoundTripper(documentRoot string, timeout time.Duration) *RoundTripper {
+	return &RoundTripper{
+		DocumentRoot: documentRoot,
+		Timeout:      timeout,
+		pool:         newConnPool(),
+	}
+}
+
+// ParseAddress extracts the dial network and address from a request URL
+// produced for an `fcgi://` backend. The backend's authority is carried
+// in url.Opaque (set by the caller instead of Host) so that a `unix:`
+// prefixed socket path parses without net/url mistaking it for a port.
+//
+//	fcgi://127.0.0.1:9000        -> ("tcp", "127.0.0.1:9000")
+//	fcgi://unix:/run/php-fpm.sock -> ("unix", "/run/php-fpm.sock")
+func ParseAddress(u *url.URL) (network, address string, err error) {
+	if u.Scheme != "fcgi" {
+		return "", "", fmt.Errorf("fastcgi: unsupported scheme %q", u.Scheme)
+	}
+
+	rest := u.Opaque
+	if rest == "" {
+		return "", "", fmt.Errorf("fastcgi: empty backend address")
+	}
+
+	if strings.HasPrefix(rest, "unix:") {
+		return "unix", strings.TrimPrefix(rest, "unix:"), nil
+	}
+	return "tcp", rest, nil
+}
+
+// RoundTrip sends req to the FastCGI application server named by
+// req.URL and returns its response, streaming the body as it is
+// produced rather than buffering it in full.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	network, address, err := ParseAddress(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := rt.pool.get(network, address, rt.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if rt.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(rt.Timeout))
+	}
+
+	params := buildParams(req, rt.DocumentRoot)
+
+	pr, pw := io.Pipe()
+	var stderrBuf bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		client := &Client{}
+		_, doErr := client.Do(conn, params, req.Body, pw, &stderrBuf)
+		pw.CloseWithError(doErr)
+		done <- doErr
+	}()
+
+	bodyReader := bufio.NewReader(pr)
+	status, header, err := parseCGIHeader(bodyReader)
+	if err != nil {
+		pr.CloseWithError(err)
+		conn.Close()
+		<-done
+		return nil, err
+	}
+
+	if stderrBuf.Len() > 0 {
+		log.Printf("fastcgi: %s: %s", address, stderrBuf.String())
+	}
+
+	return &http.Response{
+		Status:     http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body: &roundTripBody{
+			r:       bodyReader,
+			pr:      pr,
+			conn:    conn,
+			pool:    rt.pool,
+			network: network,
+			address: address,
+			done:    done,
+		},
+		Request: req,
+	}, nil
+}
+
+// parseCGIHeader reads the CGI response header block (terminated by a
+// blank line) and translates the CGI `Status` pseudo-header into an
+// HTTP status code, defaulting to 200 when absent.
+func parseCGIHeader(r *bufio.Reader) (int, http.Header, error) {
+	tp := textproto.NewReader(r)
+	mimeHeader, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+
+	header := http.Header(mimeHeader)
+	status := http.StatusOK
+	if s := header.Get("Status"); s != "" {
+		if fields := strings.Fields(s); len(fields) > 0 {
+			if code, convErr := strconv.Atoi(fields[0]); convErr == nil {
+				status = code
+			}
+		}
+		header.Del("Status")
+	}
+
+	return status, header, nil
+}
+
+// buildParams constructs the standard CGI environment for req.
+func buildParams(req *http.Request, documentRoot string) map[string]string {
+	params := map[string]string{
+		"GATEWAY_INTERFACE": "CGI/1.1",
+		"SERVER_PROTOCOL":   "HTTP/1.1",
+		"SERVER_SOFTWARE":   "reverse_proxy",
+		"SERVER_NAME":       req.Host,
+		"REQUEST_METHOD":    req.Method,
+		"REQUEST_URI":       req.URL.RequestURI(),
+		"SCRIPT_NAME":       req.URL.Path,
+		"SCRIPT_FILENAME":   filepath.Join(documentRoot, req.URL.Path),
+		"DOCUMENT_ROOT":     documentRoot,
+		"QUERY_STRING":      req.URL.RawQuery,
+		"CONTENT_TYPE":      req.Header.Get("Content-Type"),
+		"REMOTE_ADDR":       remoteIP(req),
+	}
+
+	// CONTENT_LENGTH must be a non-negative decimal or absent per CGI/1.1;
+	// req.ContentLength is -1 when the incoming request has no declared
+	// length (e.g. chunked transfer encoding), so omit it rather than
+	// sending the literal "-1".
+	if req.ContentLength >= 0 {
+		params["CONTENT_LENGTH"] = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	for name, values := range req.Header {
+		if len(values) == 0 {
+			continue
+		}
+		key := "HTTP_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		params[key] = strings.Join(values, ", ")
+	}
+
+	return params
+}
+
+// remoteIP strips the port from req.RemoteAddr for the REMOTE_ADDR param.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// roundTripBody streams the FastCGI STDOUT body to the caller and, once
+// fully read and closed, returns the underlying connection to the pool
+// (or closes it, if the request ended in error).
+type roundTripBody struct {
+	r                *bufio.Reader
+	pr               *io.PipeReader
+	conn             net.Conn
+	pool             *connPool
+	network, address string
+	done             chan error
+	closed           bool
+}
+
+func (b *roundTripBody) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func (b *roundTripBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	io.Copy(io.Discard, b.r)
+	err := <-b.done
+	b.pr.Close()
+	b.conn.SetDeadline(time.Time{})
+
+	if err != nil {
+		b.conn.Close()
+		return nil
+	}
+	b.pool.put(b.network, b.address, b.conn)
+	return nil
+}